@@ -6,30 +6,49 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
 	"log/slog"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/jessevdk/go-flags"
 	"github.com/pkg/errors"
+
+	"github.com/tiagomelo/kafka-partition-skew-example/internal/encoding"
+	"github.com/tiagomelo/kafka-partition-skew-example/internal/metrics"
 )
 
 // options represents the command line options.
 type options struct {
-	KafkaBrokers string `short:"b" long:"brokers" description:"Comma separated list of Kafka brokers" default:"localhost:29092"`
-	Topic        string `short:"t" long:"topic" description:"Kafka topic to produce messages to" required:"true"`
-	Group        string `short:"g" long:"group" description:"Kafka consumer group" required:"true"`
-	WorkMs       int    `short:"w" long:"work-ms" description:"Milliseconds to simulate work per message" default:"2"`
+	KafkaBrokers        string `short:"b" long:"brokers" description:"Comma separated list of Kafka brokers" default:"localhost:29092"`
+	Topic               string `short:"t" long:"topic" description:"Kafka topic to produce messages to" required:"true"`
+	Group               string `short:"g" long:"group" description:"Kafka consumer group" required:"true"`
+	WorkMs              int    `short:"w" long:"work-ms" description:"Milliseconds to simulate work per message" default:"2"`
+	Rebalance           string `long:"rebalance" description:"Rebalance strategy: range, roundrobin, sticky or cooperative-sticky" default:"range"`
+	WorkersPerPartition int    `long:"workers-per-partition" description:"Number of worker goroutines fanned out per claimed partition" default:"1"`
+	MetricsAddr         string `long:"metrics-addr" description:"Address to expose Prometheus metrics on, e.g. :9090 (disabled if empty)"`
+	Encoding            string `long:"encoding" description:"Message value encoding: json, avro or protobuf" default:"json"`
+	SchemaRegistry      string `long:"schema-registry" description:"Schema Registry URL, required for --encoding=avro or --encoding=protobuf"`
+	ExactlyOnce         bool   `long:"exactly-once" description:"Consume-transform-produce inside Kafka transactions for exactly-once semantics"`
+	OutputTopic         string `long:"output-topic" description:"Topic results are produced to, required when --exactly-once is set"`
+	TxnIDPrefix         string `long:"txn-id-prefix" description:"Prefix used to build each session's TransactionalID in --exactly-once mode" default:"txn-consumer"`
+	IsolationLevel      string `long:"isolation-level" description:"Consumer isolation level in --exactly-once mode (read_uncommitted or read_committed)" default:"read_committed"`
+	TxnBatchSize        int    `long:"txn-batch-size" description:"Number of messages committed per transaction in --exactly-once mode" default:"50"`
 }
 
 // handler represents a Sarama consumer group handler.
 type handler struct {
-	work time.Duration
-	log  *slog.Logger
+	work    time.Duration
+	workers int
+	codec   encoding.Codec
+	metrics *metrics.Consumer
+	log     *slog.Logger
 }
 
 // Setup is run at the beginning of a new session, before ConsumeClaim.
@@ -49,8 +68,21 @@ func (h handler) Cleanup(sarama.ConsumerGroupSession) error {
 // consume messages is not necessary. Messages must be marked as processed
 // by calling the MarkMessage method of the ConsumerGroupSession.
 func (h handler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if h.workers <= 1 {
+		return h.consumeSerial(sess, claim)
+	}
+	return h.consumeParallel(sess, claim)
+}
+
+// consumeSerial processes a claim's messages one at a time, in offset
+// order, marking each as soon as it completes.
+func (h handler) consumeSerial(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	p := claim.Partition()
 	for msg := range claim.Messages() {
+		start := time.Now()
+		if _, err := h.codec.Decode(msg.Value); err != nil {
+			h.log.ErrorContext(context.Background(), "failed to decode message", slog.Any("err", err))
+		}
 		// simulate constant work per message.
 		time.Sleep(h.work)
 
@@ -64,33 +96,333 @@ func (h handler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.Con
 		}
 		// mark message as processed.
 		sess.MarkMessage(msg, "")
+		if h.metrics != nil {
+			h.metrics.ObserveMessage(p, msg.Offset, time.Since(start))
+		}
+	}
+	return nil
+}
+
+// consumeParallel fans a claim's messages out across h.workers goroutines,
+// routing each key to the same worker every time so a single player's
+// events are never reordered relative to each other, even though the
+// partition as a whole is processed by more than one worker. Offsets are
+// only marked once an offsetTracker confirms the contiguous prefix up to
+// them has completed, since workers can finish out of order.
+func (h handler) consumeParallel(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	p := claim.Partition()
+	queues := make([]chan *sarama.ConsumerMessage, h.workers)
+	for i := range queues {
+		queues[i] = make(chan *sarama.ConsumerMessage, 64)
+	}
+
+	var tracker *offsetTracker
+	var wg sync.WaitGroup
+	wg.Add(h.workers)
+	for _, q := range queues {
+		go func(q <-chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+			for msg := range q {
+				start := time.Now()
+				if _, err := h.codec.Decode(msg.Value); err != nil {
+					h.log.ErrorContext(context.Background(), "failed to decode message", slog.Any("err", err))
+				}
+				// simulate constant work per message.
+				time.Sleep(h.work)
+
+				// log every N offsets to visualize partition skew.
+				if msg.Offset%500 == 0 {
+					h.log.Info("message",
+						slog.Int("partition", int(p)),
+						slog.Int64("offset", msg.Offset),
+						slog.String("key", string(msg.Key)),
+					)
+				}
+				tracker.complete(sess, msg)
+				if h.metrics != nil {
+					h.metrics.ObserveMessage(p, msg.Offset, time.Since(start))
+				}
+			}
+		}(q)
+	}
+
+	for msg := range claim.Messages() {
+		if tracker == nil {
+			tracker = newOffsetTracker()
+		}
+		tracker.dispatch(msg)
+		queues[workerFor(msg.Key, h.workers)] <- msg
+	}
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+	return nil
+}
+
+// workerFor deterministically maps a message key to one of numWorkers
+// worker goroutines, so every message for the same key always lands on the
+// same worker and is processed in the order it was received.
+func workerFor(key []byte, numWorkers int) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(numWorkers))
+}
+
+// offsetTracker marks offsets with the consumer session only once every
+// offset claimed ahead of it has completed, keeping MarkMessage calls
+// monotonic even when a pool of workers finishes messages out of order.
+// It orders by claim/dispatch order rather than assuming claimed offsets
+// are contiguous integers: transaction control records and compacted or
+// read_committed topics (this module's own --exactly-once producers
+// included) open gaps in the offset sequence that never appear on
+// claim.Messages(), so a tracker keyed on "next integer offset" would
+// wedge the first time one of those gaps was claimed.
+type offsetTracker struct {
+	mu        sync.Mutex
+	pending   []int64 // offsets dispatched, in claim order, not yet completed
+	completed map[int64]*sarama.ConsumerMessage
+}
+
+// newOffsetTracker returns an empty tracker.
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{completed: make(map[int64]*sarama.ConsumerMessage)}
+}
+
+// dispatch records that msg has been handed to a worker, preserving the
+// order it was claimed in.
+func (t *offsetTracker) dispatch(msg *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(t.pending, msg.Offset)
+}
+
+// complete records msg as done and marks every offset in the now-complete
+// prefix of pending.
+func (t *offsetTracker) complete(sess sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.completed[msg.Offset] = msg
+	for len(t.pending) > 0 {
+		next, ok := t.completed[t.pending[0]]
+		if !ok {
+			return
+		}
+		sess.MarkMessage(next, "")
+		delete(t.completed, t.pending[0])
+		t.pending = t.pending[1:]
+	}
+}
+
+// txnHandler is a Sarama consumer group handler that consumes messages,
+// produces results to an output topic and commits the consumed offsets,
+// all inside a single Kafka transaction per batch.
+type txnHandler struct {
+	brokers      []string
+	producerCfg  *sarama.Config
+	group        string
+	sourceTopic  string
+	outputTopic  string
+	txnIDPrefix  string
+	txnBatchSize int
+	metrics      *metrics.Consumer
+	log          *slog.Logger
+
+	producer sarama.AsyncProducer
+}
+
+// Setup opens a transactional producer for this session, using a
+// TransactionalID derived from the consumer group, member and partition so
+// that rebalances never hand the same transactional ID to two producers.
+func (h *txnHandler) Setup(sess sarama.ConsumerGroupSession) error {
+	claims := sess.Claims()[h.sourceTopic]
+	partition := int32(-1)
+	if len(claims) > 0 {
+		partition = claims[0]
+	}
+
+	cfg := *h.producerCfg
+	cfg.Producer.Transaction.ID = fmt.Sprintf("%s-%s-%s-%d", h.txnIDPrefix, h.group, sess.MemberID(), partition)
+
+	producer, err := sarama.NewAsyncProducer(h.brokers, &cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to create transactional producer")
+	}
+	h.producer = producer
+	return nil
+}
+
+// Cleanup closes the session's transactional producer.
+func (h *txnHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	if h.producer == nil {
+		return nil
+	}
+	return h.producer.Close()
+}
+
+// ConsumeClaim consumes a batch of messages, produces a transformed result
+// for each to the output topic, attaches the consumed offsets to the same
+// transaction and commits, aborting and retrying on abortable errors.
+func (h *txnHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := context.Background()
+	topic := claim.Topic()
+	partition := claim.Partition()
+
+	var inTxn int
+	var lastMsg *sarama.ConsumerMessage
+
+	beginTxn := func() error {
+		if err := h.producer.BeginTxn(); err != nil {
+			return errors.Wrap(err, "failed to begin transaction")
+		}
+		return nil
+	}
+
+	commit := func() error {
+		offsets := map[string][]*sarama.PartitionOffsetMetadata{
+			topic: {
+				{Partition: partition, Offset: lastMsg.Offset + 1},
+			},
+		}
+		if err := h.producer.AddOffsetsToTxn(offsets, h.group); err != nil {
+			return errors.Wrap(err, "failed to add offsets to transaction")
+		}
+
+		if err := h.producer.CommitTxn(); err != nil {
+			if h.producer.TxnStatus()&sarama.ProducerTxnFlagAbortableError != 0 {
+				h.log.ErrorContext(ctx, "abortable transaction error, aborting batch", slog.Any("err", err))
+				if abortErr := h.producer.AbortTxn(); abortErr != nil {
+					return errors.Wrap(abortErr, "failed to abort transaction")
+				}
+				// the abort discarded the batch's produced records and its
+				// offsets were never committed (AddOffsetsToTxn only staged
+				// them), so inTxn/lastMsg must not carry over: returning an
+				// error here ends this ConsumeClaim, which restarts the
+				// session and re-delivers the batch from the last
+				// successfully committed offset instead of resuming with a
+				// stale inTxn count against no open transaction.
+				inTxn = 0
+				lastMsg = nil
+				return errors.Wrap(err, "aborted transaction, restarting session to retry batch")
+			}
+			if h.producer.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0 {
+				return errors.Wrap(err, "fatal transaction error")
+			}
+			return err
+		}
+		sess.MarkMessage(lastMsg, "")
+		inTxn = 0
+		return nil
+	}
+
+	for msg := range claim.Messages() {
+		start := time.Now()
+		if inTxn == 0 {
+			if err := beginTxn(); err != nil {
+				return err
+			}
+		}
+
+		out := &sarama.ProducerMessage{
+			Topic: h.outputTopic,
+			Key:   sarama.ByteEncoder(msg.Key),
+			Value: sarama.ByteEncoder(msg.Value),
+		}
+		h.producer.Input() <- out
+
+		lastMsg = msg
+		inTxn++
+		if h.metrics != nil {
+			h.metrics.ObserveMessage(partition, msg.Offset, time.Since(start))
+		}
+
+		if inTxn >= h.txnBatchSize {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if inTxn > 0 {
+		return commit()
 	}
 	return nil
 }
 
 // run starts the consumer.
-func run(kafkaBrokers, topic, group string, workMs int, log *slog.Logger) error {
+func run(kafkaBrokers, topic, group string, workMs int, rebalance string, workersPerPartition int, metricsAddr, encodingName, schemaRegistry string, exactlyOnce bool, outputTopic, txnIDPrefix, isolationLevel string, txnBatchSize int, log *slog.Logger) error {
 	ctx := context.Background()
 	defer log.InfoContext(ctx, "completed")
 
+	if exactlyOnce && outputTopic == "" {
+		return errors.New("--output-topic is required when --exactly-once is set")
+	}
+
+	codec, err := encoding.NewCodec(encodingName, schemaRegistry, topic)
+	if err != nil {
+		return errors.Wrap(err, "failed to build codec")
+	}
+
 	brokers := strings.Split(kafkaBrokers, ",")
 
+	rebalanceStrategy, err := balanceStrategy(rebalance)
+	if err != nil {
+		return err
+	}
+
 	cfg := sarama.NewConfig()
 	cfg.Version = sarama.V3_6_0_0
-	// range strategy makes skew obvious (same partition stays with same member).
-	cfg.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRange()
+	// range keeps skew obvious (same partition stays with same member);
+	// the other strategies trade that off against smoother rebalances.
+	cfg.Consumer.Group.Rebalance.Strategy = rebalanceStrategy
 	cfg.Consumer.Return.Errors = true
 
+	if exactlyOnce {
+		if isolationLevel == "read_uncommitted" {
+			cfg.Consumer.IsolationLevel = sarama.ReadUncommitted
+		} else {
+			cfg.Consumer.IsolationLevel = sarama.ReadCommitted
+		}
+		// the consumer must mark offsets itself once a transaction commits.
+		cfg.Consumer.Offsets.AutoCommit.Enable = false
+	}
+
 	client, err := sarama.NewConsumerGroup(brokers, group, cfg)
 	if err != nil {
 		return errors.Wrap(err, "failed to create kafka consumer group")
 	}
 	defer client.Close()
 
+	var consMetrics *metrics.Consumer
+	if metricsAddr != "" {
+		consMetrics = metrics.NewConsumer()
+
+		// sarama.ConsumerGroup doesn't expose the sarama.Client it consumes
+		// with, so lag polling needs one of its own purely to call
+		// GetOffset.
+		lagClient, err := sarama.NewClient(brokers, cfg)
+		if err != nil {
+			return errors.Wrap(err, "failed to create kafka client for lag metrics")
+		}
+		defer lagClient.Close()
+
+		lagCtx, cancelLag := context.WithCancel(context.Background())
+		defer cancelLag()
+		go consMetrics.WatchLag(lagCtx, lagClient, topic, 5*time.Second)
+
+		metricsSrv := metrics.Serve(metricsAddr, log)
+		defer metricsSrv.Close()
+	}
+
 	log.InfoContext(ctx, "consumer started",
 		slog.String("brokers", kafkaBrokers),
 		slog.String("group", group),
 		slog.String("topic", topic),
+		slog.String("rebalance", rebalance),
+		slog.Int("workersPerPartition", workersPerPartition),
+		slog.String("encoding", encodingName),
+		slog.Bool("exactlyOnce", exactlyOnce),
 	)
 
 	// shutdown and error channels.
@@ -102,7 +434,32 @@ func run(kafkaBrokers, topic, group string, workMs int, log *slog.Logger) error
 
 	go func() {
 		for {
-			consumeErrors <- client.Consume(ctx, []string{topic}, handler{work: time.Duration(workMs) * time.Millisecond, log: log})
+			var h sarama.ConsumerGroupHandler
+			if exactlyOnce {
+				producerCfg := sarama.NewConfig()
+				producerCfg.Producer.Idempotent = true
+				producerCfg.Producer.RequiredAcks = sarama.WaitForAll
+				producerCfg.Net.MaxOpenRequests = 1
+
+				h = &txnHandler{
+					brokers:      brokers,
+					producerCfg:  producerCfg,
+					group:        group,
+					sourceTopic:  topic,
+					outputTopic:  outputTopic,
+					txnIDPrefix:  txnIDPrefix,
+					txnBatchSize: txnBatchSize,
+					metrics:      consMetrics,
+					log:          log,
+				}
+			} else {
+				h = handler{work: time.Duration(workMs) * time.Millisecond, workers: workersPerPartition, codec: codec, metrics: consMetrics, log: log}
+			}
+			// a nil return means the session ended (a rebalance, or a
+			// ConsumeClaim that returned an error): loop to join a new one.
+			if err := client.Consume(ctx, []string{topic}, h); err != nil {
+				consumeErrors <- err
+			}
 		}
 	}()
 
@@ -126,6 +483,36 @@ func run(kafkaBrokers, topic, group string, workMs int, log *slog.Logger) error
 	return nil
 }
 
+// balanceStrategy maps a --rebalance flag value to its Sarama strategy.
+func balanceStrategy(name string) (sarama.BalanceStrategy, error) {
+	switch name {
+	case "", "range":
+		return sarama.NewBalanceStrategyRange(), nil
+	case "roundrobin":
+		return sarama.NewBalanceStrategyRoundRobin(), nil
+	case "sticky":
+		return sarama.NewBalanceStrategySticky(), nil
+	case "cooperative-sticky":
+		return cooperativeStickyBalanceStrategy{sarama.NewBalanceStrategySticky()}, nil
+	default:
+		return nil, errors.Errorf("unknown rebalance strategy %q", name)
+	}
+}
+
+// cooperativeStickyBalanceStrategy wraps Sarama's sticky strategy, reusing
+// its partition assignment algorithm under the "cooperative-sticky" group
+// protocol name. Sarama doesn't ship a dedicated constructor for it; the
+// two protocols differ in how the broker/members handle revocation, not in
+// the assignment plan, so overriding Name is enough to advertise it.
+type cooperativeStickyBalanceStrategy struct {
+	sarama.BalanceStrategy
+}
+
+// Name implements sarama.BalanceStrategy.
+func (cooperativeStickyBalanceStrategy) Name() string {
+	return "cooperative-sticky"
+}
+
 func main() {
 	var opts options
 	parser := flags.NewParser(&opts, flags.Default)
@@ -134,7 +521,7 @@ func main() {
 		os.Exit(1)
 	}
 	log := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	if err := run(opts.KafkaBrokers, opts.Topic, opts.Group, opts.WorkMs, log); err != nil {
+	if err := run(opts.KafkaBrokers, opts.Topic, opts.Group, opts.WorkMs, opts.Rebalance, opts.WorkersPerPartition, opts.MetricsAddr, opts.Encoding, opts.SchemaRegistry, opts.ExactlyOnce, opts.OutputTopic, opts.TxnIDPrefix, opts.IsolationLevel, opts.TxnBatchSize, log); err != nil {
 		log.Error("error", slog.Any("err", err))
 		os.Exit(1)
 	}
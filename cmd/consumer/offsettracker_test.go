@@ -0,0 +1,79 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// fakeSession is a minimal sarama.ConsumerGroupSession that only records
+// MarkMessage calls, since that's all offsetTracker drives.
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	marked []int64
+}
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func TestOffsetTrackerMarksInOrder(t *testing.T) {
+	sess := &fakeSession{}
+	tr := newOffsetTracker()
+
+	msgs := []*sarama.ConsumerMessage{
+		{Offset: 0}, {Offset: 1}, {Offset: 2},
+	}
+	for _, m := range msgs {
+		tr.dispatch(m)
+	}
+
+	// complete out of order: 2, 0, 1.
+	tr.complete(sess, msgs[2])
+	if len(sess.marked) != 0 {
+		t.Fatalf("marked = %v, want none yet (0 and 1 still pending)", sess.marked)
+	}
+
+	tr.complete(sess, msgs[0])
+	if got := sess.marked; len(got) != 1 || got[0] != 0 {
+		t.Fatalf("marked = %v, want [0]", got)
+	}
+
+	tr.complete(sess, msgs[1])
+	if got := sess.marked; len(got) != 3 || got[1] != 1 || got[2] != 2 {
+		t.Fatalf("marked = %v, want [0 1 2]", got)
+	}
+}
+
+func TestOffsetTrackerToleratesOffsetGaps(t *testing.T) {
+	sess := &fakeSession{}
+	tr := newOffsetTracker()
+
+	// offset 1 is a gap (e.g. a transaction control record) never
+	// delivered to claim.Messages(); the tracker must not wedge waiting
+	// for it.
+	msgs := []*sarama.ConsumerMessage{
+		{Offset: 0}, {Offset: 2}, {Offset: 3},
+	}
+	for _, m := range msgs {
+		tr.dispatch(m)
+	}
+
+	for _, m := range msgs {
+		tr.complete(sess, m)
+	}
+
+	want := []int64{0, 2, 3}
+	if len(sess.marked) != len(want) {
+		t.Fatalf("marked = %v, want %v", sess.marked, want)
+	}
+	for i, w := range want {
+		if sess.marked[i] != w {
+			t.Fatalf("marked = %v, want %v", sess.marked, want)
+		}
+	}
+}
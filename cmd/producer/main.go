@@ -18,38 +18,68 @@ import (
 	"github.com/IBM/sarama"
 	"github.com/jessevdk/go-flags"
 	"github.com/pkg/errors"
+
+	"github.com/tiagomelo/kafka-partition-skew-example/internal/encoding"
+	"github.com/tiagomelo/kafka-partition-skew-example/internal/metrics"
+	"github.com/tiagomelo/kafka-partition-skew-example/internal/partitioner"
 )
 
 // options represents the command line options.
 type options struct {
-	KafkaBrokers string `short:"b" long:"brokers" description:"Comma separated list of Kafka brokers" default:"localhost:29092"`
-	Topic        string `short:"t" long:"topic" description:"Kafka topic to produce messages to" required:"true"`
-	Rate         int    `short:"r" long:"rate" description:"Messages per second to produce" default:"400"`
-	SkewPercent  int    `short:"s" long:"skew-percent" description:"Percentage of messages to send to a single partition to simulate skew" default:"95"`
-}
-
-// gameEvent represents a game event message.
-type gameEvent struct {
-	ID        int64
-	PlayerID  string
-	GameID    string
-	EventType string
-	Amount    int
-	TableID   string
-	TS        int64
+	KafkaBrokers   string `short:"b" long:"brokers" description:"Comma separated list of Kafka brokers" default:"localhost:29092"`
+	Topic          string `short:"t" long:"topic" description:"Kafka topic to produce messages to" required:"true"`
+	Rate           int    `short:"r" long:"rate" description:"Messages per second to produce" default:"400"`
+	SkewPercent    int    `short:"s" long:"skew-percent" description:"Percentage of messages to send to a single partition to simulate skew" default:"95"`
+	Partitioner    string `long:"partitioner" description:"Partitioning strategy: hash, shard, p2c or chbl" default:"hash"`
+	MetricsAddr    string `long:"metrics-addr" description:"Address to expose Prometheus metrics on, e.g. :9090 (disabled if empty)"`
+	Encoding       string `long:"encoding" description:"Message value encoding: json, avro or protobuf" default:"json"`
+	SchemaRegistry string `long:"schema-registry" description:"Schema Registry URL, required for --encoding=avro or --encoding=protobuf"`
+	ExactlyOnce    bool   `long:"exactly-once" description:"Produce inside Kafka transactions for exactly-once semantics"`
+	TxnID          string `long:"txn-id" description:"Transactional ID, required when --exactly-once is set"`
+	TxnBatchSize   int    `long:"txn-batch-size" description:"Number of messages committed per transaction in --exactly-once mode" default:"50"`
 }
 
 // run starts the producer.
-func run(kafkaBrokers, topic string, rate, skewPercent int, log *slog.Logger) error {
+func run(kafkaBrokers, topic string, rate, skewPercent int, partitionerName, metricsAddr, encodingName, schemaRegistry string, exactlyOnce bool, txnID string, txnBatchSize int, log *slog.Logger) error {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	ctx := context.Background()
 	defer log.InfoContext(ctx, "completed")
 
+	if exactlyOnce && txnID == "" {
+		return errors.New("--txn-id is required when --exactly-once is set")
+	}
+
+	tracker := partitioner.NewLoadTracker()
+	partitionerConstructor, err := partitioner.NewConstructor(partitionerName, tracker)
+	if err != nil {
+		return errors.Wrap(err, "failed to build partitioner")
+	}
+
 	brokers := strings.Split(kafkaBrokers, ",")
 	cfg := sarama.NewConfig()
-	// wait for only the local commit to succeed before responding.
-	cfg.Producer.RequiredAcks = sarama.WaitForLocal
+	cfg.Producer.Partitioner = partitionerConstructor
+	if exactlyOnce {
+		// transactional producers require idempotence, a single in-flight
+		// request per connection and acks from every in-sync replica.
+		cfg.Producer.Idempotent = true
+		cfg.Producer.RequiredAcks = sarama.WaitForAll
+		cfg.Net.MaxOpenRequests = 1
+		cfg.Producer.Transaction.ID = txnID
+	} else {
+		// wait for only the local commit to succeed before responding.
+		cfg.Producer.RequiredAcks = sarama.WaitForLocal
+	}
+	// load-aware strategies need to observe where messages actually land, as
+	// does the metrics tap below.
+	loadAware := partitionerName == "p2c" || partitionerName == "chbl"
+	var prodMetrics *metrics.Producer
+	if metricsAddr != "" {
+		prodMetrics = metrics.NewProducer()
+	}
+	if loadAware || prodMetrics != nil {
+		cfg.Producer.Return.Successes = true
+	}
 	// the producer will wait for all in-sync replicas to ack the message
 	// before responding.
 	asyncProducer, err := sarama.NewAsyncProducer(brokers, cfg)
@@ -58,11 +88,28 @@ func run(kafkaBrokers, topic string, rate, skewPercent int, log *slog.Logger) er
 	}
 	defer asyncProducer.Close()
 
+	if loadAware || prodMetrics != nil {
+		go trackLoad(asyncProducer, tracker, prodMetrics)
+	}
+
+	if metricsAddr != "" {
+		metricsSrv := metrics.Serve(metricsAddr, log)
+		defer metricsSrv.Close()
+	}
+
+	codec, err := encoding.NewCodec(encodingName, schemaRegistry, topic)
+	if err != nil {
+		return errors.Wrap(err, "failed to build codec")
+	}
+
 	log.InfoContext(ctx, "producer started",
 		slog.String("brokers", kafkaBrokers),
 		slog.String("topic", topic),
 		slog.Int("rate", rate),
 		slog.Int("skewPercent", skewPercent),
+		slog.String("partitioner", partitionerName),
+		slog.String("encoding", encodingName),
+		slog.Bool("exactlyOnce", exactlyOnce),
 	)
 
 	// control the rate of message production.
@@ -75,6 +122,7 @@ func run(kafkaBrokers, topic string, rate, skewPercent int, log *slog.Logger) er
 
 	go func() {
 		var i int64
+		var inTxn int
 		for {
 			<-ticker.C
 
@@ -87,7 +135,7 @@ func run(kafkaBrokers, topic string, rate, skewPercent int, log *slog.Logger) er
 			}
 
 			// create a realistic event (bet placed / hand finished).
-			ev := gameEvent{
+			ev := encoding.GameEvent{
 				ID:        i,
 				PlayerID:  playerID,
 				GameID:    fmt.Sprintf("game-%d", r.Intn(50)),
@@ -97,15 +145,42 @@ func run(kafkaBrokers, topic string, rate, skewPercent int, log *slog.Logger) er
 				TS:        time.Now().UnixMilli(),
 			}
 
-			// key by player_id (this causes skew for the VIP).
-			key := playerID
-			val := fmt.Sprintf(`{"id":%d,"player_id":"%s","game_id":"%s","event_type":"%s","amount":%d,"table_id":"%s","ts":%d}`,
-				ev.ID, ev.PlayerID, ev.GameID, ev.EventType, ev.Amount, ev.TableID, ev.TS)
+			val, err := codec.Encode(ev)
+			if err != nil {
+				log.ErrorContext(ctx, "failed to encode event", slog.Any("err", err))
+				continue
+			}
 
+			// key by player_id (this causes skew for the VIP).
 			msg := &sarama.ProducerMessage{
 				Topic: topic,
-				Key:   sarama.StringEncoder(key),
-				Value: sarama.StringEncoder(val),
+				Key:   sarama.StringEncoder(playerID),
+				Value: sarama.ByteEncoder(val),
+			}
+
+			if exactlyOnce {
+				if inTxn == 0 {
+					if err := asyncProducer.BeginTxn(); err != nil {
+						log.ErrorContext(ctx, "failed to begin transaction", slog.Any("err", err))
+						continue
+					}
+				}
+
+				// in exactly-once mode every enqueued message belongs to the
+				// open transaction, committed once txnBatchSize messages are
+				// in it, so a message can't be silently dropped here the way
+				// the non-transactional path drops under backpressure: the
+				// committed transaction would then be missing records counted
+				// as sent. Block until the producer accepts it instead.
+				asyncProducer.Input() <- msg
+				i++
+				inTxn++
+
+				if inTxn >= txnBatchSize {
+					commitTxn(ctx, asyncProducer, log)
+					inTxn = 0
+				}
+				continue
 			}
 
 			select {
@@ -113,6 +188,9 @@ func run(kafkaBrokers, topic string, rate, skewPercent int, log *slog.Logger) er
 				i++
 			default:
 				// drop on backpressure to maintain pace.
+				if prodMetrics != nil {
+					prodMetrics.ObserveDrop()
+				}
 			}
 		}
 	}()
@@ -126,6 +204,9 @@ func run(kafkaBrokers, topic string, rate, skewPercent int, log *slog.Logger) er
 
 	done := make(chan struct{})
 	go func() {
+		if exactlyOnce && asyncProducer.TxnStatus()&sarama.ProducerTxnFlagInTransaction != 0 {
+			commitTxn(shutdownCtx, asyncProducer, log)
+		}
 		// closing the producer flushes any buffered messages.
 		asyncProducer.Close()
 		close(done)
@@ -141,6 +222,72 @@ func run(kafkaBrokers, topic string, rate, skewPercent int, log *slog.Logger) er
 	return nil
 }
 
+// trackLoad drains the async producer's Successes() and Errors() channels,
+// feeding the bytes produced for each partition into tracker so the p2c and
+// chbl partitioners can route future keys around hot partitions, and into
+// prodMetrics (if not nil) for the Prometheus /metrics endpoint.
+func trackLoad(producer sarama.AsyncProducer, tracker *partitioner.LoadTracker, prodMetrics *metrics.Producer) {
+	for {
+		select {
+		case msg, ok := <-producer.Successes():
+			if !ok {
+				return
+			}
+			tracker.Record(msg.Partition, messageSize(msg))
+			if prodMetrics != nil {
+				prodMetrics.ObserveSuccess(msg.Partition, keyShard(msg.Key))
+			}
+
+		case err, ok := <-producer.Errors():
+			if !ok {
+				return
+			}
+			tracker.Record(err.Msg.Partition, messageSize(err.Msg))
+			if prodMetrics != nil {
+				prodMetrics.ObserveError()
+			}
+		}
+	}
+}
+
+// messageSize returns the encoded key+value size of msg, used as the unit
+// of load the partitioners balance across partitions.
+func messageSize(msg *sarama.ProducerMessage) int {
+	var n int
+	if msg.Key != nil {
+		n += msg.Key.Length()
+	}
+	if msg.Value != nil {
+		n += msg.Value.Length()
+	}
+	return n
+}
+
+// keyShard returns the key_shard metric label for a message. This producer
+// doesn't shard keys (unlike producer_balanced), so every message shares
+// the same label rather than creating one series per player ID.
+func keyShard(sarama.Encoder) string {
+	return "none"
+}
+
+// commitTxn commits the producer's current transaction. On an abortable
+// error it aborts the transaction, discarding its messages, which are not
+// re-sent; a fatal error is only logged.
+func commitTxn(ctx context.Context, producer sarama.AsyncProducer, log *slog.Logger) {
+	if err := producer.CommitTxn(); err != nil {
+		if producer.TxnStatus()&sarama.ProducerTxnFlagAbortableError != 0 {
+			log.ErrorContext(ctx, "abortable transaction error, aborting batch", slog.Any("err", err))
+			if abortErr := producer.AbortTxn(); abortErr != nil {
+				log.ErrorContext(ctx, "failed to abort transaction", slog.Any("err", abortErr))
+			}
+			return
+		}
+		if producer.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0 {
+			log.ErrorContext(ctx, "fatal transaction error", slog.Any("err", err))
+		}
+	}
+}
+
 func main() {
 	var opts options
 	parser := flags.NewParser(&opts, flags.Default)
@@ -149,7 +296,7 @@ func main() {
 		os.Exit(1)
 	}
 	log := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	if err := run(opts.KafkaBrokers, opts.Topic, opts.Rate, opts.SkewPercent, log); err != nil {
+	if err := run(opts.KafkaBrokers, opts.Topic, opts.Rate, opts.SkewPercent, opts.Partitioner, opts.MetricsAddr, opts.Encoding, opts.SchemaRegistry, opts.ExactlyOnce, opts.TxnID, opts.TxnBatchSize, log); err != nil {
 		log.Error("error", slog.Any("err", err))
 		os.Exit(1)
 	}
@@ -0,0 +1,113 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package encoding
+
+import (
+	"github.com/hamba/avro/v2"
+	"github.com/pkg/errors"
+	"github.com/riferrei/srclient"
+)
+
+// gameEventAvroSchema is the Avro schema registered for GameEvent values.
+const gameEventAvroSchema = `{
+  "type": "record",
+  "name": "GameEvent",
+  "namespace": "kafka_partition_skew_example",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "player_id", "type": "string"},
+    {"name": "game_id", "type": "string"},
+    {"name": "event_type", "type": "string"},
+    {"name": "amount", "type": "int"},
+    {"name": "table_id", "type": "string"},
+    {"name": "ts", "type": "long"}
+  ]
+}`
+
+// avroCodec implements Codec using Avro binary encoding under the
+// Confluent wire format: a magic byte, a 4-byte schema ID and the Avro
+// binary payload.
+type avroCodec struct {
+	client   *srclient.SchemaRegistryClient
+	schemaID int
+	schema   avro.Schema
+
+	schemas *schemaCache
+}
+
+// newAvroCodec registers gameEventAvroSchema for topic's value subject
+// against the registry at registryURL and returns a Codec bound to the
+// schema ID it's assigned.
+func newAvroCodec(registryURL, topic string) (*avroCodec, error) {
+	if registryURL == "" {
+		return nil, errors.New("--schema-registry is required for --encoding=avro")
+	}
+
+	client := srclient.CreateSchemaRegistryClient(registryURL)
+	schema, err := client.CreateSchema(topic+"-value", gameEventAvroSchema, srclient.Avro)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to register avro schema")
+	}
+
+	parsed, err := avro.Parse(gameEventAvroSchema)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse avro schema")
+	}
+
+	c := &avroCodec{
+		client:   client,
+		schemaID: schema.ID(),
+		schema:   parsed,
+		schemas:  newSchemaCache(schemaCacheSize),
+	}
+	c.schemas.put(schema.ID(), gameEventAvroSchema)
+	return c, nil
+}
+
+// Encode implements Codec.
+func (c *avroCodec) Encode(event GameEvent) ([]byte, error) {
+	payload, err := avro.Marshal(c.schema, event)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal avro payload")
+	}
+	return appendConfluentHeader(c.schemaID, payload), nil
+}
+
+// Decode implements Codec, resolving the writer's schema ID through the
+// local cache before falling back to the registry.
+func (c *avroCodec) Decode(data []byte) (GameEvent, error) {
+	var event GameEvent
+
+	schemaID, payload, err := splitConfluentHeader(data)
+	if err != nil {
+		return event, err
+	}
+
+	schema, err := c.schemaFor(schemaID)
+	if err != nil {
+		return event, err
+	}
+
+	if err := avro.Unmarshal(schema, payload, &event); err != nil {
+		return event, errors.Wrap(err, "failed to unmarshal avro payload")
+	}
+	return event, nil
+}
+
+// schemaFor resolves schemaID to a parsed avro.Schema, consulting the LRU
+// cache before asking the registry.
+func (c *avroCodec) schemaFor(schemaID int) (avro.Schema, error) {
+	if raw, ok := c.schemas.get(schemaID); ok {
+		return avro.Parse(raw)
+	}
+
+	s, err := c.client.GetSchema(schemaID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch avro schema from registry")
+	}
+	c.schemas.put(schemaID, s.Schema())
+
+	return avro.Parse(s.Schema())
+}
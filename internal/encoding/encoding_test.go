@@ -0,0 +1,110 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package encoding
+
+import (
+	"testing"
+
+	"github.com/hamba/avro/v2"
+)
+
+// testEvent is a representative GameEvent round-tripped through every codec.
+var testEvent = GameEvent{
+	ID:        42,
+	PlayerID:  "player-000001",
+	GameID:    "game-7",
+	EventType: "bet_placed",
+	Amount:    150,
+	TableID:   "table-3",
+	TS:        1700000000000,
+}
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+	c := &jsonCodec{}
+
+	data, err := c.Encode(testEvent)
+	if err != nil {
+		t.Fatalf("Encode() returned error: %v", err)
+	}
+
+	got, err := c.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() returned error: %v", err)
+	}
+	if got != testEvent {
+		t.Errorf("Decode() = %+v, want %+v", got, testEvent)
+	}
+}
+
+func TestAvroCodecRoundTrip(t *testing.T) {
+	schema, err := avro.Parse(gameEventAvroSchema)
+	if err != nil {
+		t.Fatalf("avro.Parse() returned error: %v", err)
+	}
+
+	schemas := newSchemaCache(schemaCacheSize)
+	schemas.put(1, gameEventAvroSchema)
+	c := &avroCodec{schemaID: 1, schema: schema, schemas: schemas}
+
+	data, err := c.Encode(testEvent)
+	if err != nil {
+		t.Fatalf("Encode() returned error: %v", err)
+	}
+
+	got, err := c.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() returned error: %v", err)
+	}
+	if got != testEvent {
+		t.Errorf("Decode() = %+v, want %+v", got, testEvent)
+	}
+}
+
+func TestProtobufCodecRoundTrip(t *testing.T) {
+	c := &protobufCodec{schemaID: 1}
+
+	data, err := c.Encode(testEvent)
+	if err != nil {
+		t.Fatalf("Encode() returned error: %v", err)
+	}
+
+	got, err := c.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() returned error: %v", err)
+	}
+	if got != testEvent {
+		t.Errorf("Decode() = %+v, want %+v", got, testEvent)
+	}
+}
+
+func TestConfluentHeaderRoundTrip(t *testing.T) {
+	data := appendConfluentHeader(1234, []byte("payload"))
+
+	schemaID, payload, err := splitConfluentHeader(data)
+	if err != nil {
+		t.Fatalf("splitConfluentHeader() returned error: %v", err)
+	}
+	if schemaID != 1234 {
+		t.Errorf("schemaID = %d, want 1234", schemaID)
+	}
+	if string(payload) != "payload" {
+		t.Errorf("payload = %q, want %q", payload, "payload")
+	}
+}
+
+func TestSplitConfluentHeaderRejectsMalformedData(t *testing.T) {
+	cases := map[string][]byte{
+		"too short":   {0x0, 0x1, 0x2},
+		"wrong magic": append([]byte{0x1}, make([]byte, 8)...),
+		"empty":       {},
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := splitConfluentHeader(data); err == nil {
+				t.Error("splitConfluentHeader() returned no error, want one")
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package encoding
+
+import "encoding/json"
+
+// jsonCodec replaces the hand-rolled fmt.Sprintf JSON this module used to
+// build inline; the wire format is the same, but it's now generated and
+// parsed instead of assembled by hand.
+type jsonCodec struct{}
+
+// Encode implements Codec.
+func (jsonCodec) Encode(event GameEvent) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// Decode implements Codec.
+func (jsonCodec) Decode(data []byte) (GameEvent, error) {
+	var event GameEvent
+	err := json.Unmarshal(data, &event)
+	return event, err
+}
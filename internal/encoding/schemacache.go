@@ -0,0 +1,77 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package encoding
+
+import (
+	"container/list"
+	"sync"
+)
+
+// schemaCacheSize bounds how many distinct schema IDs a decoder keeps
+// resolved locally before evicting the least recently used entry.
+const schemaCacheSize = 128
+
+// schemaCache is a small LRU cache mapping a Schema Registry schema ID to
+// its raw schema text, so decoding a stream doesn't hit the registry for
+// every message.
+type schemaCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[int]*list.Element
+	order    *list.List
+}
+
+// schemaCacheEntry is the value stored in order; id is kept alongside
+// schema so eviction can remove the matching entries map key.
+type schemaCacheEntry struct {
+	id     int
+	schema string
+}
+
+// newSchemaCache returns an empty cache holding at most capacity entries.
+func newSchemaCache(capacity int) *schemaCache {
+	return &schemaCache{
+		capacity: capacity,
+		entries:  make(map[int]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the cached schema for id, if present, moving it to the
+// front of the recency order.
+func (c *schemaCache) get(id int) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[id]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*schemaCacheEntry).schema, true
+}
+
+// put stores schema under id, evicting the least recently used entry if
+// the cache is over capacity.
+func (c *schemaCache) put(id int, schema string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[id]; ok {
+		el.Value.(*schemaCacheEntry).schema = schema
+		c.order.MoveToFront(el)
+		return
+	}
+
+	el := c.order.PushFront(&schemaCacheEntry{id: id, schema: schema})
+	c.entries[id] = el
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*schemaCacheEntry).id)
+		}
+	}
+}
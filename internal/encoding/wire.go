@@ -0,0 +1,33 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package encoding
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// confluentMagicByte prefixes every Confluent wire-format value, ahead of
+// the 4-byte big-endian schema ID.
+const confluentMagicByte = 0x0
+
+// appendConfluentHeader prepends the Confluent wire-format header (magic
+// byte + 4-byte schema ID) to payload.
+func appendConfluentHeader(schemaID int, payload []byte) []byte {
+	out := make([]byte, 0, 5+len(payload))
+	out = append(out, confluentMagicByte)
+	out = binary.BigEndian.AppendUint32(out, uint32(schemaID))
+	return append(out, payload...)
+}
+
+// splitConfluentHeader validates and strips the Confluent wire-format
+// header from data, returning the schema ID and the remaining payload.
+func splitConfluentHeader(data []byte) (int, []byte, error) {
+	if len(data) < 5 || data[0] != confluentMagicByte {
+		return 0, nil, errors.New("data is not a Confluent wire-format message")
+	}
+	return int(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+// Package metrics exposes Prometheus counters, histograms and gauges
+// describing per-partition throughput and skew for the producer and
+// consumer commands, so the demo can be driven from Grafana instead of the
+// ad-hoc "log every 500 offsets" heuristic.
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Producer holds the metrics published by the producer commands.
+type Producer struct {
+	MessagesTotal          *prometheus.CounterVec
+	ErrorsTotal            prometheus.Counter
+	BackpressureDropsTotal prometheus.Counter
+	ShardCount             *prometheus.GaugeVec
+}
+
+// NewProducer registers and returns a fresh set of producer metrics.
+func NewProducer() *Producer {
+	return &Producer{
+		MessagesTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_produced_messages_total",
+			Help: "Total number of messages successfully produced, by destination partition and key shard.",
+		}, []string{"partition", "key_shard"}),
+		ErrorsTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "kafka_produce_errors_total",
+			Help: "Total number of messages Kafka reported as failed to produce.",
+		}),
+		BackpressureDropsTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "kafka_produce_backpressure_drops_total",
+			Help: "Total number of messages dropped because the producer's input channel was full.",
+		}),
+		ShardCount: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "producer_shard_count",
+			Help: "Current number of shards a hot key's traffic is spread across, by key.",
+		}, []string{"key"}),
+	}
+}
+
+// ObserveSuccess records a successfully produced message.
+func (p *Producer) ObserveSuccess(partition int32, keyShard string) {
+	p.MessagesTotal.WithLabelValues(strconv.Itoa(int(partition)), keyShard).Inc()
+}
+
+// ObserveError records a produce failure.
+func (p *Producer) ObserveError() {
+	p.ErrorsTotal.Inc()
+}
+
+// ObserveDrop records a message dropped under backpressure.
+func (p *Producer) ObserveDrop() {
+	p.BackpressureDropsTotal.Inc()
+}
+
+// SetShardCount publishes the current shard fan-out in use for key.
+func (p *Producer) SetShardCount(key string, shards int) {
+	p.ShardCount.WithLabelValues(key).Set(float64(shards))
+}
+
+// Consumer holds the metrics published by the consumer command.
+type Consumer struct {
+	MessagesTotal     *prometheus.CounterVec
+	ProcessingSeconds *prometheus.HistogramVec
+	Lag               *prometheus.GaugeVec
+
+	mu         sync.Mutex
+	lastMarked map[int32]int64
+}
+
+// NewConsumer registers and returns a fresh set of consumer metrics.
+func NewConsumer() *Consumer {
+	return &Consumer{
+		MessagesTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_consumer_messages_total",
+			Help: "Total number of messages consumed, by partition.",
+		}, []string{"partition"}),
+		ProcessingSeconds: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "kafka_consumer_processing_seconds",
+			Help: "Time spent processing a single message.",
+		}, []string{"partition"}),
+		Lag: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kafka_consumer_lag",
+			Help: "Difference between a partition's newest offset and the highest offset this consumer has processed.",
+		}, []string{"partition"}),
+		lastMarked: make(map[int32]int64),
+	}
+}
+
+// ObserveMessage records a consumed message and how long it took to
+// process, and remembers the highest offset reported for partition so
+// WatchLag can diff against it. The consumer reports each message once it
+// is processed, so with parallel workers or transactional batches the
+// remembered offset can be ahead of the last one actually marked or
+// committed.
+func (c *Consumer) ObserveMessage(partition int32, offset int64, took time.Duration) {
+	label := strconv.Itoa(int(partition))
+	c.MessagesTotal.WithLabelValues(label).Inc()
+	c.ProcessingSeconds.WithLabelValues(label).Observe(took.Seconds())
+
+	c.mu.Lock()
+	// parallel consumption completes messages out of order, so a later
+	// call here can carry an earlier offset than one already recorded;
+	// only the highest offset seen is kept.
+	if prev, ok := c.lastMarked[partition]; !ok || offset > prev {
+		c.lastMarked[partition] = offset
+	}
+	c.mu.Unlock()
+}
+
+// markedOffsets returns a snapshot of the offset ObserveMessage remembered
+// per partition.
+func (c *Consumer) markedOffsets() map[int32]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make(map[int32]int64, len(c.lastMarked))
+	for partition, offset := range c.lastMarked {
+		out[partition] = offset
+	}
+	return out
+}
+
+// WatchLag polls client for topic's newest offset on every partition this
+// consumer has recorded progress on, and publishes the gap to Lag every
+// interval, until ctx is cancelled.
+func (c *Consumer) WatchLag(ctx context.Context, client sarama.Client, topic string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for partition, marked := range c.markedOffsets() {
+				newest, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+				if err != nil {
+					continue
+				}
+				c.Lag.WithLabelValues(strconv.Itoa(int(partition))).Set(float64(newest - marked))
+			}
+		}
+	}
+}
+
+// Serve starts an HTTP server exposing the default Prometheus registry on
+// /metrics at addr. The caller is responsible for shutting it down.
+func Serve(addr string, log *slog.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error("metrics server stopped", slog.Any("err", err))
+		}
+	}()
+	return srv
+}
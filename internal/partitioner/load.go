@@ -0,0 +1,97 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package partitioner
+
+import (
+	"sync"
+	"time"
+)
+
+// loadWindow is the sliding window over which per-partition load is
+// measured. Both skew-aware strategies route new keys away from whichever
+// partitions have produced the most bytes in this window.
+const loadWindow = 5 * time.Second
+
+// bucket holds the bytes produced for a partition during a single second of
+// wall-clock time, so the tracker can expire old activity without scanning
+// every recorded message.
+type bucket struct {
+	second int64
+	bytes  int64
+}
+
+// LoadTracker keeps a sliding-window byte count per partition, fed from the
+// async producer's Successes() and Errors() channels. It is safe for
+// concurrent use by the producer goroutine and by partitioners called from
+// Sarama's internal dispatch goroutines.
+type LoadTracker struct {
+	mu      sync.Mutex
+	buckets map[int32][]bucket
+}
+
+// NewLoadTracker returns an empty LoadTracker.
+func NewLoadTracker() *LoadTracker {
+	return &LoadTracker{buckets: make(map[int32][]bucket)}
+}
+
+// Record adds n bytes of load to the given partition at the current second.
+func (t *LoadTracker) Record(partition int32, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now().Unix()
+	bs := t.buckets[partition]
+	if len(bs) > 0 && bs[len(bs)-1].second == now {
+		bs[len(bs)-1].bytes += int64(n)
+	} else {
+		bs = append(bs, bucket{second: now, bytes: int64(n)})
+	}
+	t.buckets[partition] = trim(bs, now)
+}
+
+// Load returns the total bytes recorded for the given partition within the
+// trailing window.
+func (t *LoadTracker) Load(partition int32) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now().Unix()
+	bs := trim(t.buckets[partition], now)
+	t.buckets[partition] = bs
+
+	var total int64
+	for _, b := range bs {
+		total += b.bytes
+	}
+	return total
+}
+
+// Total returns the sum of Load across every partition that has recorded
+// activity, used by the bounded-load strategy to compute the fair share.
+func (t *LoadTracker) Total() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now().Unix()
+	var total int64
+	for p, bs := range t.buckets {
+		bs = trim(bs, now)
+		t.buckets[p] = bs
+		for _, b := range bs {
+			total += b.bytes
+		}
+	}
+	return total
+}
+
+// trim drops buckets that have fallen outside loadWindow.
+func trim(bs []bucket, now int64) []bucket {
+	cutoff := now - int64(loadWindow/time.Second)
+	i := 0
+	for i < len(bs) && bs[i].second <= cutoff {
+		i++
+	}
+	return bs[i:]
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+// Package partitioner implements pluggable, skew-aware partition selection
+// strategies for the producers in this module, selectable via the
+// --partitioner flag instead of the inline sarama.StringEncoder(key) path
+// this repo used to rely on exclusively.
+package partitioner
+
+import (
+	"hash/fnv"
+
+	"github.com/IBM/sarama"
+	"github.com/pkg/errors"
+)
+
+// BoundedLoadEpsilon is the default slack (ε) allowed above the fair share
+// of load per partition in the "chbl" strategy: a partition is eligible
+// once its load is at most (1+ε) times total_load/num_partitions.
+const BoundedLoadEpsilon = 0.25
+
+// NewConstructor returns a sarama.PartitionerConstructor for the named
+// strategy ("hash", "shard", "p2c" or "chbl"). The "p2c" and "chbl"
+// strategies consult tracker, which the caller must keep fed from the
+// producer's Successes()/Errors() channels.
+func NewConstructor(name string, tracker *LoadTracker) (sarama.PartitionerConstructor, error) {
+	switch name {
+	case "", "hash":
+		return sarama.NewHashPartitioner, nil
+
+	case "shard":
+		// identical hashing to "hash"; kept as its own name because this is
+		// the strategy the balanced producer already relies on by encoding
+		// "#shard=N" into the key before it ever reaches the partitioner.
+		return sarama.NewHashPartitioner, nil
+
+	case "p2c":
+		return func(topic string) sarama.Partitioner {
+			return &powerOfTwoChoicesPartitioner{topic: topic, tracker: tracker}
+		}, nil
+
+	case "chbl":
+		return func(topic string) sarama.Partitioner {
+			return &boundedLoadPartitioner{topic: topic, tracker: tracker, epsilon: BoundedLoadEpsilon}
+		}, nil
+
+	default:
+		return nil, errors.Errorf("unknown partitioner %q", name)
+	}
+}
+
+// hashKey hashes message's key with FNV-1a, salted with seed so two calls
+// with different seeds land on unrelated partitions for the same key.
+func hashKey(message *sarama.ProducerMessage, seed byte) (uint32, error) {
+	key, err := message.Key.Encode()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to encode partition key")
+	}
+	h := fnv.New32a()
+	h.Write([]byte{seed})
+	h.Write(key)
+	return h.Sum32(), nil
+}
+
+// powerOfTwoChoicesPartitioner hashes the key to two candidate partitions
+// with different seeds and routes to whichever has less load recorded in
+// the trailing window, approximating the "power of two choices" technique.
+type powerOfTwoChoicesPartitioner struct {
+	topic   string
+	tracker *LoadTracker
+}
+
+// Partition implements sarama.Partitioner.
+func (p *powerOfTwoChoicesPartitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if message.Key == nil {
+		return sarama.NewHashPartitioner(p.topic).Partition(message, numPartitions)
+	}
+
+	h1, err := hashKey(message, 0x1)
+	if err != nil {
+		return 0, err
+	}
+	h2, err := hashKey(message, 0x2)
+	if err != nil {
+		return 0, err
+	}
+
+	c1 := int32(h1 % uint32(numPartitions))
+	c2 := int32(h2 % uint32(numPartitions))
+	if p.tracker.Load(c2) < p.tracker.Load(c1) {
+		return c2, nil
+	}
+	return c1, nil
+}
+
+// RequiresConsistency implements sarama.Partitioner. The choice depends on
+// live load rather than purely on the key, so Sarama must not assume equal
+// keys always land on the same partition.
+func (p *powerOfTwoChoicesPartitioner) RequiresConsistency() bool {
+	return false
+}
+
+// boundedLoadPartitioner implements consistent hashing with bounded loads:
+// a key hashes to its "home" partition on a ring, then the ring is walked
+// forward until a partition under (1+epsilon) times the fair share is
+// found, keeping the mapping close to consistent hashing while bounding
+// how far any single partition can drift above average load.
+type boundedLoadPartitioner struct {
+	topic   string
+	tracker *LoadTracker
+	epsilon float64
+}
+
+// Partition implements sarama.Partitioner.
+func (p *boundedLoadPartitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if message.Key == nil {
+		return sarama.NewHashPartitioner(p.topic).Partition(message, numPartitions)
+	}
+
+	h, err := hashKey(message, 0x0)
+	if err != nil {
+		return 0, err
+	}
+
+	home := int32(h % uint32(numPartitions))
+	ring := ringOrder(home, numPartitions)
+
+	capacity := p.fairShareCapacity(numPartitions)
+	for _, candidate := range ring {
+		if p.tracker.Load(candidate) <= capacity {
+			return candidate, nil
+		}
+	}
+	// every partition is over its fair share; fall back to the home
+	// partition rather than failing the send.
+	return home, nil
+}
+
+// fairShareCapacity returns (1+epsilon) * total_load / num_partitions,
+// i.e. the most load a partition may carry before it is skipped.
+func (p *boundedLoadPartitioner) fairShareCapacity(numPartitions int32) int64 {
+	total := p.tracker.Total()
+	if total == 0 {
+		return 0
+	}
+	fairShare := float64(total) / float64(numPartitions)
+	return int64((1 + p.epsilon) * fairShare)
+}
+
+// RequiresConsistency implements sarama.Partitioner.
+func (p *boundedLoadPartitioner) RequiresConsistency() bool {
+	return false
+}
+
+// ringOrder returns every partition in [0, numPartitions) starting at home
+// and walking forward with wraparound, the order a hash ring lookup would
+// visit them in.
+func ringOrder(home, numPartitions int32) []int32 {
+	order := make([]int32, 0, numPartitions)
+	for i := int32(0); i < numPartitions; i++ {
+		order = append(order, (home+i)%numPartitions)
+	}
+	return order
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package shardpolicy
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+	"github.com/pkg/errors"
+)
+
+// AdminLagSource computes lag from the cluster's committed consumer group
+// offsets, the same numbers `kafka-consumer-groups.sh --describe` reports.
+type AdminLagSource struct {
+	admin  sarama.ClusterAdmin
+	client sarama.Client
+}
+
+// NewAdminLagSource connects to brokers and returns a LagSource backed by a
+// Kafka cluster admin.
+func NewAdminLagSource(brokers []string, cfg *sarama.Config) (*AdminLagSource, error) {
+	client, err := sarama.NewClient(brokers, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create kafka client")
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, errors.Wrap(err, "failed to create kafka cluster admin")
+	}
+	return &AdminLagSource{admin: admin, client: client}, nil
+}
+
+// Close releases the underlying admin connection.
+func (s *AdminLagSource) Close() error {
+	return s.admin.Close()
+}
+
+// MaxLag implements LagSource by diffing group's committed offset against
+// each partition's newest offset and returning the largest gap.
+func (s *AdminLagSource) MaxLag(ctx context.Context, group, topic string) (int64, error) {
+	offsets, err := s.admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: nil})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list consumer group offsets")
+	}
+
+	var max int64
+	for partition, block := range offsets.Blocks[topic] {
+		if block.Err != sarama.ErrNoError || block.Offset < 0 {
+			continue
+		}
+		newest, err := s.client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			continue
+		}
+		if lag := newest - block.Offset; lag > max {
+			max = lag
+		}
+	}
+	return max, nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+// Package shardpolicy implements a self-tuning controller that adapts how
+// many shards the balanced producer spreads a hot key across, based on
+// downstream consumer lag, so the static --shards value doesn't have to be
+// retuned by hand as traffic shifts.
+package shardpolicy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRaiseAfter and DefaultLowerAfter are the hysteresis windows used
+// unless a caller needs something else: a lag spike must persist for
+// DefaultRaiseAfter before the shard count grows, and drain for
+// DefaultLowerAfter before it shrinks, so a brief blip doesn't cause the
+// fan-out to oscillate.
+const (
+	DefaultRaiseAfter = 5 * time.Second
+	DefaultLowerAfter = 30 * time.Second
+)
+
+// LagSource reports the worst lag, in messages, observed across a topic's
+// partitions for a consumer group.
+type LagSource interface {
+	MaxLag(ctx context.Context, group, topic string) (int64, error)
+}
+
+// Policy adapts a single key's shard count between min and max shards,
+// raising it once lag has stayed above threshold for raiseAfter and
+// lowering it once lag has stayed at or below threshold for lowerAfter.
+type Policy struct {
+	min, max   int
+	threshold  int64
+	raiseAfter time.Duration
+	lowerAfter time.Duration
+
+	mu         sync.Mutex
+	shards     int
+	overSince  time.Time
+	underSince time.Time
+}
+
+// New returns a Policy starting at min shards, growing towards max as lag
+// exceeds threshold.
+func New(min, max int, threshold int64, raiseAfter, lowerAfter time.Duration) (*Policy, error) {
+	if min < 1 || max < min {
+		return nil, errors.Errorf("invalid shard bounds: min=%d max=%d", min, max)
+	}
+	return &Policy{
+		min:        min,
+		max:        max,
+		threshold:  threshold,
+		raiseAfter: raiseAfter,
+		lowerAfter: lowerAfter,
+		shards:     min,
+	}, nil
+}
+
+// Shards returns the current shard count.
+func (p *Policy) Shards() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.shards
+}
+
+// Observe feeds the latest lag reading, taken at now, into the hysteresis
+// state machine and returns the resulting shard count.
+func (p *Policy) Observe(now time.Time, lag int64) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if lag > p.threshold {
+		p.underSince = time.Time{}
+		if p.overSince.IsZero() {
+			p.overSince = now
+		}
+		if p.shards < p.max && now.Sub(p.overSince) >= p.raiseAfter {
+			p.shards++
+			p.overSince = now
+		}
+	} else {
+		p.overSince = time.Time{}
+		if p.underSince.IsZero() {
+			p.underSince = now
+		}
+		if p.shards > p.min && now.Sub(p.underSince) >= p.lowerAfter {
+			p.shards--
+			p.underSince = now
+		}
+	}
+	return p.shards
+}
+
+// Run polls source every interval and feeds the readings to Observe until
+// ctx is cancelled, invoking onChange whenever the shard count changes. A
+// failed poll is skipped rather than treated as zero lag.
+func (p *Policy) Run(ctx context.Context, source LagSource, group, topic string, interval time.Duration, onChange func(shards int)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lag, err := source.MaxLag(ctx, group, topic)
+			if err != nil {
+				continue
+			}
+			before := p.Shards()
+			after := p.Observe(time.Now(), lag)
+			if after != before && onChange != nil {
+				onChange(after)
+			}
+		}
+	}
+}
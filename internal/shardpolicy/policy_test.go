@@ -0,0 +1,92 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package shardpolicy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyObserveRaisesAfterSustainedOverage(t *testing.T) {
+	p, err := New(1, 4, 100, 5*time.Second, 30*time.Second)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	base := time.Unix(1700000000, 0)
+
+	if got := p.Observe(base, 200); got != 1 {
+		t.Fatalf("Observe() = %d, want 1 (first overage, raiseAfter not yet elapsed)", got)
+	}
+	if got := p.Observe(base.Add(4999*time.Millisecond), 200); got != 1 {
+		t.Fatalf("Observe() = %d, want 1 (just short of raiseAfter)", got)
+	}
+	if got := p.Observe(base.Add(5*time.Second), 200); got != 2 {
+		t.Fatalf("Observe() = %d, want 2 (raiseAfter elapsed)", got)
+	}
+}
+
+func TestPolicyObserveDipResetsOverageWindow(t *testing.T) {
+	p, err := New(1, 4, 100, 5*time.Second, 30*time.Second)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	base := time.Unix(1700000000, 0)
+
+	p.Observe(base, 200)
+	if got := p.Observe(base.Add(3*time.Second), 50); got != 1 {
+		t.Fatalf("Observe() = %d, want 1 (dip below threshold)", got)
+	}
+	// 6s after the first spike, but the dip cleared the overage window,
+	// so it restarts at this reading: must not have raised yet.
+	if got := p.Observe(base.Add(6*time.Second), 200); got != 1 {
+		t.Fatalf("Observe() = %d, want 1 (overage window restarted by the dip)", got)
+	}
+}
+
+func TestPolicyObserveLowersAfterSustainedUnderage(t *testing.T) {
+	p, err := New(1, 4, 100, 1*time.Second, 2*time.Second)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	base := time.Unix(1700000000, 0)
+
+	p.Observe(base, 200)
+	if got := p.Observe(base.Add(time.Second), 200); got != 2 {
+		t.Fatalf("Observe() = %d, want 2 (raised)", got)
+	}
+	if got := p.Observe(base.Add(time.Second+time.Millisecond), 50); got != 2 {
+		t.Fatalf("Observe() = %d, want 2 (just dipped under, lowerAfter not yet elapsed)", got)
+	}
+	if got := p.Observe(base.Add(2*time.Second+900*time.Millisecond), 50); got != 2 {
+		t.Fatalf("Observe() = %d, want 2 (just short of lowerAfter)", got)
+	}
+	if got := p.Observe(base.Add(3*time.Second+time.Millisecond), 50); got != 1 {
+		t.Fatalf("Observe() = %d, want 1 (lowerAfter elapsed)", got)
+	}
+}
+
+func TestPolicyObserveClampsToMax(t *testing.T) {
+	p, err := New(1, 2, 100, time.Second, time.Second)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	base := time.Unix(1700000000, 0)
+	p.Observe(base, 200)
+	p.Observe(base.Add(2*time.Second), 200) // raises to 2 (max)
+	got := p.Observe(base.Add(4*time.Second), 200)
+	if got != 2 {
+		t.Errorf("Observe() = %d, want 2 (clamped to max)", got)
+	}
+}
+
+func TestNewRejectsInvalidBounds(t *testing.T) {
+	if _, err := New(0, 4, 100, time.Second, time.Second); err == nil {
+		t.Error("New() with min=0 returned no error, want one")
+	}
+	if _, err := New(4, 2, 100, time.Second, time.Second); err == nil {
+		t.Error("New() with max<min returned no error, want one")
+	}
+}
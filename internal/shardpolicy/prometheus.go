@@ -0,0 +1,66 @@
+// Copyright (c) 2025 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package shardpolicy
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PrometheusLagSource reads the kafka_consumer_lag gauge (see
+// internal/metrics) scraped from a consumer's /metrics endpoint.
+type PrometheusLagSource struct {
+	url string
+}
+
+// NewPrometheusLagSource returns a LagSource that scrapes url, typically a
+// consumer's "http://host:9090/metrics" endpoint, on every MaxLag call.
+func NewPrometheusLagSource(url string) *PrometheusLagSource {
+	return &PrometheusLagSource{url: url}
+}
+
+// MaxLag implements LagSource. group and topic are ignored: the scraped
+// kafka_consumer_lag gauge is already scoped to whichever consumer process
+// is being polled.
+func (s *PrometheusLagSource) MaxLag(ctx context.Context, _, _ string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to build metrics scrape request")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to scrape metrics endpoint")
+	}
+	defer resp.Body.Close()
+
+	var max int64
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "kafka_consumer_lag{") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		lag, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		if int64(lag) > max {
+			max = int64(lag)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, errors.Wrap(err, "failed to read metrics scrape response")
+	}
+	return max, nil
+}